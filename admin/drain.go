@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/eBay/fabio/proxy"
+	"github.com/eBay/fabio/route"
+)
+
+// DrainHandler implements POST /api/drain, the code path that actually
+// executes the `drain <service>` / `undrain <service>` commands
+// documented in route.Commands. The request body is the raw command
+// line, e.g. "drain svc-a".
+func (s *Server) DrainHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := strings.Fields(string(body))
+	if len(fields) != 2 {
+		http.Error(w, "want: drain <service> | undrain <service>", http.StatusBadRequest)
+		return
+	}
+	cmd, service := fields[0], fields[1]
+
+	switch cmd {
+	case "drain":
+		if proxy.DefaultTransport == nil {
+			http.Error(w, "proxy transport not initialized yet", http.StatusServiceUnavailable)
+			return
+		}
+		proxy.DrainService(proxy.DefaultTransport, service, s.Cfg.Proxy.ShutdownWait)
+	case "undrain":
+		route.Undrain(service)
+	default:
+		http.Error(w, fmt.Sprintf("unknown command %q", cmd), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/eBay/fabio/config"
+	"github.com/eBay/fabio/metrics"
+	"github.com/eBay/fabio/route"
+)
+
+// Dump is the document GET /api/dump emits and POST /api/restore
+// accepts. It captures everything needed to reproduce a fabio instance's
+// routing state offline: the active config (with credentials redacted,
+// see redactConfig), the route table in the same config language
+// watchBackend builds, the manual overrides layered on top of it, and a
+// snapshot of the per-route runtime counters so that a
+// production/staging diff also shows which routes were actually serving
+// traffic, not just which routes were configured.
+type Dump struct {
+	Config  interface{}            `json:"config"`
+	Routes  string                 `json:"routes"`
+	Manual  string                 `json:"manual"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+// sensitiveField matches config field names that must never be written
+// to an unauthenticated HTTP response: consul ACL tokens, vault
+// credentials, TLS private keys and the like.
+var sensitiveField = regexp.MustCompile(`(?i)(token|secret|password|passwd|credential|privatekey|private_key|apikey|api_key)`)
+
+// redactConfig round-trips cfg through JSON and blanks out any field
+// whose name matches sensitiveField, anywhere in the structure. A
+// generic, name-based pass is used instead of a field-by-field redaction
+// because config.Config gains new nested structs -- most recently the
+// per-listener TLS options and the NATS JetStream registry -- faster
+// than a hand-maintained allow-list could keep up, and the failure mode of missing one here is
+// a credential leak rather than a missing debug field.
+func redactConfig(cfg *config.Config) (interface{}, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	redact(v)
+	return v, nil
+}
+
+func redact(v interface{}) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			if sensitiveField.MatchString(k) {
+				x[k] = "***"
+				continue
+			}
+			redact(val)
+		}
+	case []interface{}:
+		for _, e := range x {
+			redact(e)
+		}
+	}
+}
+
+// DumpHandler implements GET /api/dump.
+func (s *Server) DumpHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	redacted, err := redactConfig(s.Cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d := Dump{
+		Config:  redacted,
+		Routes:  route.GetTable().String(),
+		Manual:  route.GetManual(),
+		Metrics: metrics.DefaultRegistry.Snapshot(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// RestoreHandler implements POST /api/restore.
+//
+// Restoring is only accepted when the configured registry backend is
+// "file" or "static" since those are the backends where fabio itself
+// owns the route table rather than mirroring one a live registry is the
+// source of truth for -- restoring a dump taken against a consul backed
+// instance would just be undone by the next registry watch event. The
+// dump's (redacted) Config field is informational only and is never
+// applied.
+func (s *Server) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch s.Cfg.Registry.Backend {
+	case "file", "static":
+	default:
+		http.Error(w, "restore is only supported for the file and static registry backends", http.StatusBadRequest)
+		return
+	}
+
+	var d Dump
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := route.NewTable(d.Routes + "\n" + d.Manual)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	route.SetTable(t)
+
+	w.WriteHeader(http.StatusNoContent)
+}
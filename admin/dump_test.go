@@ -0,0 +1,65 @@
+package admin
+
+import "testing"
+
+func TestSensitiveField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"Token", true},
+		{"ConsulToken", true},
+		{"vault_token", true},
+		{"Password", true},
+		{"Passwd", true},
+		{"Credential", true},
+		{"PrivateKey", true},
+		{"private_key", true},
+		{"APIKey", true},
+		{"api_key", true},
+		{"Addr", false},
+		{"Bucket", false},
+		{"ServiceName", false},
+	}
+
+	for _, tt := range tests {
+		if got := sensitiveField.MatchString(tt.field); got != tt.want {
+			t.Errorf("sensitiveField.MatchString(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	in := map[string]interface{}{
+		"addr":  "127.0.0.1:8500",
+		"token": "s3cr3t",
+		"nested": map[string]interface{}{
+			"private_key": "-----BEGIN KEY-----",
+			"bucket":      "fabio",
+		},
+		"list": []interface{}{
+			map[string]interface{}{"password": "hunter2"},
+		},
+	}
+
+	redact(in)
+
+	if in["addr"] != "127.0.0.1:8500" {
+		t.Errorf("addr was redacted: %v", in["addr"])
+	}
+	if in["token"] != "***" {
+		t.Errorf("token was not redacted: %v", in["token"])
+	}
+	nested := in["nested"].(map[string]interface{})
+	if nested["private_key"] != "***" {
+		t.Errorf("nested private_key was not redacted: %v", nested["private_key"])
+	}
+	if nested["bucket"] != "fabio" {
+		t.Errorf("nested bucket was redacted: %v", nested["bucket"])
+	}
+	list := in["list"].([]interface{})
+	entry := list[0].(map[string]interface{})
+	if entry["password"] != "***" {
+		t.Errorf("list entry password was not redacted: %v", entry["password"])
+	}
+}
@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/eBay/fabio/route"
+)
+
+// LocalityHandler implements GET /api/locality, exposing the address set
+// the "localityfirst" strategy caches at startup so operators can see why
+// a given pick was made -- e.g. to confirm a target was skipped because
+// it wasn't recognized as colocated.
+func (s *Server) LocalityHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(route.LocalAddrs()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
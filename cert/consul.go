@@ -0,0 +1,44 @@
+package cert
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulSource loads certificate material from keys under a consul KV
+// prefix, alongside the route table and manual overrides fabio already
+// reads from consul. This lets operators roll a certificate the same way
+// they roll a route change: write new KV values, no restart required.
+type ConsulSource struct {
+	Client *api.Client
+	Prefix string // e.g. "fabio/tls/www.example.com"
+}
+
+func (s *ConsulSource) Fetch() (certPEM, keyPEM, caPEM []byte, err error) {
+	certPEM, err = s.get("cert")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyPEM, err = s.get("key")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caPEM, _ = s.get("ca") // optional
+	return certPEM, keyPEM, caPEM, nil
+}
+
+func (s *ConsulSource) get(key string) ([]byte, error) {
+	kv, _, err := s.Client.KV().Get(s.Prefix+"/"+key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cert: consul get %s/%s: %s", s.Prefix, key, err)
+	}
+	if kv == nil {
+		return nil, fmt.Errorf("cert: consul key %s/%s not found", s.Prefix, key)
+	}
+	return kv.Value, nil
+}
+
+func (s *ConsulSource) String() string {
+	return "consul:" + s.Prefix
+}
@@ -0,0 +1,36 @@
+package cert
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// FileSource loads certificate material from files on disk, e.g. the
+// output of certbot or a mounted Kubernetes TLS secret.
+type FileSource struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string // optional, required for mTLS listeners
+}
+
+func (s *FileSource) Fetch() (certPEM, keyPEM, caPEM []byte, err error) {
+	certPEM, err = ioutil.ReadFile(s.CertFile)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cert: read %s: %s", s.CertFile, err)
+	}
+	keyPEM, err = ioutil.ReadFile(s.KeyFile)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cert: read %s: %s", s.KeyFile, err)
+	}
+	if s.CAFile != "" {
+		caPEM, err = ioutil.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("cert: read %s: %s", s.CAFile, err)
+		}
+	}
+	return certPEM, keyPEM, caPEM, nil
+}
+
+func (s *FileSource) String() string {
+	return "file:" + s.CertFile
+}
@@ -0,0 +1,67 @@
+package cert
+
+import (
+	"fmt"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// NewSourceFromSpec builds the Source named by a cfg.Listen entry's cert
+// option, e.g.:
+//
+//	cert=file:/etc/fabio/tls.crt,/etc/fabio/tls.key
+//	cert=file:/etc/fabio/tls.crt,/etc/fabio/tls.key,/etc/fabio/ca.crt
+//	cert=consul:fabio/tls/www.example.com
+//	cert=vault:pki/fabio-server/www.example.com
+//
+// startListener calls this once per "https" listener and passes the
+// Source to cert.NewManager to obtain the *tls.Config installed on the
+// listener. "tcp+sni" listeners never terminate TLS at fabio, so they
+// never have a Source to build.
+func NewSourceFromSpec(spec string) (Source, error) {
+	scheme, rest, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("cert: invalid spec %q, want scheme:args", spec)
+	}
+
+	switch scheme {
+	case "file":
+		parts := strings.Split(rest, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("cert: file spec %q needs cert,key[,ca]", spec)
+		}
+		src := &FileSource{CertFile: parts[0], KeyFile: parts[1]}
+		if len(parts) > 2 {
+			src.CAFile = parts[2]
+		}
+		return src, nil
+
+	case "consul":
+		// DefaultConfig picks up CONSUL_HTTP_ADDR/CONSUL_HTTP_TOKEN etc.
+		// from the environment, the same way the consul CLI and the rest
+		// of the hashicorp ecosystem bootstrap a client.
+		client, err := consulapi.NewClient(consulapi.DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("cert: consul client: %s", err)
+		}
+		return &ConsulSource{Client: client, Prefix: rest}, nil
+
+	case "vault":
+		parts := strings.SplitN(rest, "/", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("cert: vault spec %q needs mount/role/cn", spec)
+		}
+		// DefaultConfig picks up VAULT_ADDR/VAULT_TOKEN etc. from the
+		// environment, consistent with the consul client above.
+		client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("cert: vault client: %s", err)
+		}
+		return &VaultSource{Client: client, Mount: parts[0], Role: parts[1], CN: parts[2]}, nil
+
+	default:
+		return nil, fmt.Errorf("cert: unknown source %q in spec %q", scheme, spec)
+	}
+}
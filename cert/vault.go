@@ -0,0 +1,48 @@
+package cert
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// VaultSource issues a fresh short-lived certificate from a Vault PKI
+// secrets engine on every Fetch, so the Manager's poll loop doubles as
+// the renewal mechanism -- there is no long-lived certificate to rotate
+// out of band.
+type VaultSource struct {
+	Client *api.Client
+	Mount  string // e.g. "pki"
+	Role   string // e.g. "fabio-server"
+	CN     string
+}
+
+func (s *VaultSource) Fetch() (certPEM, keyPEM, caPEM []byte, err error) {
+	secret, err := s.Client.Logical().Write(fmt.Sprintf("%s/issue/%s", s.Mount, s.Role), map[string]interface{}{
+		"common_name": s.CN,
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cert: vault issue %s/%s: %s", s.Mount, s.Role, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil, nil, fmt.Errorf("cert: vault issue %s/%s returned no data", s.Mount, s.Role)
+	}
+
+	certStr, ok := secret.Data["certificate"].(string)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("cert: vault issue %s/%s: response missing \"certificate\"", s.Mount, s.Role)
+	}
+	keyStr, ok := secret.Data["private_key"].(string)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("cert: vault issue %s/%s: response missing \"private_key\"", s.Mount, s.Role)
+	}
+	certPEM, keyPEM = []byte(certStr), []byte(keyStr)
+	if ca, ok := secret.Data["issuing_ca"].(string); ok {
+		caPEM = []byte(ca)
+	}
+	return certPEM, keyPEM, caPEM, nil
+}
+
+func (s *VaultSource) String() string {
+	return fmt.Sprintf("vault:%s/%s", s.Mount, s.Role)
+}
@@ -0,0 +1,33 @@
+package config
+
+// Listen configures a single fabio listener and is the element type of
+// Config.Listen, which startListeners in main.go ranges over to start
+// one listener goroutine per entry.
+type Listen struct {
+	// Addr is the "host:port" the listener binds to.
+	Addr string
+
+	// Proto selects the protocol this listener speaks: "http" (the
+	// default), "https", or "tcp+sni" for fabio's TCP+SNI proxy.
+	// "https" requires CertSource. "tcp+sni" rejects a CertSource: it does
+	// not terminate TLS, the backend does.
+	Proto string
+
+	// CertSource names where startListener's cert.Manager loads the
+	// listener's certificate from, e.g.:
+	//
+	//	file:/etc/fabio/tls.crt,/etc/fabio/tls.key
+	//	consul:fabio/tls/www.example.com
+	//	vault:pki/fabio-server/www.example.com
+	//
+	// See cert.NewSourceFromSpec. Only "https" listeners use it, and for
+	// them it must not be empty.
+	CertSource string
+
+	// ClientAuth enables mTLS on the listener: client certificates are
+	// required and verified against CAFile/the CA bundle CertSource
+	// provides, then narrowed to ClientAuthAllowedCN/SAN if set.
+	ClientAuth           bool
+	ClientAuthAllowedCN  []string
+	ClientAuthAllowedSAN []string
+}
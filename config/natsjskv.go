@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+// NatsJSKV configures the "nats-jetstream" registry backend and is the
+// Registry.NatsJSKV field initBackend reads in main.go.
+type NatsJSKV struct {
+	// Addr is the NATS server address, e.g. "nats://127.0.0.1:4222".
+	Addr string
+
+	// Bucket is the JetStream KV bucket fabio stores service
+	// registrations in. It is created with TTL as its MaxAge if it
+	// does not exist yet.
+	Bucket string
+
+	// TTL bounds how long a registration survives without being
+	// refreshed.
+	TTL time.Duration
+
+	// ServiceName and ServiceAddr identify this fabio instance's own
+	// registration: the KV key is "service.<ServiceName>.<ServiceAddr>"
+	// with both parts URL-safe base64 encoded (see natsjskv.serviceKey).
+	ServiceName string
+	ServiceAddr string
+
+	// Routes is the config language fragment this instance publishes
+	// for its own routes, in the same syntax the other registry
+	// backends use.
+	Routes string
+}
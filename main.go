@@ -2,18 +2,22 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"runtime"
 	"runtime/debug"
 	"strings"
 	"time"
 
 	"github.com/eBay/fabio/admin"
+	"github.com/eBay/fabio/cert"
 	"github.com/eBay/fabio/config"
 	"github.com/eBay/fabio/exit"
 	"github.com/eBay/fabio/metrics"
@@ -21,6 +25,7 @@ import (
 	"github.com/eBay/fabio/registry"
 	"github.com/eBay/fabio/registry/consul"
 	"github.com/eBay/fabio/registry/file"
+	"github.com/eBay/fabio/registry/natsjskv"
 	"github.com/eBay/fabio/registry/static"
 	"github.com/eBay/fabio/route"
 	dmp "github.com/sergi/go-diff/diffmatchpatch"
@@ -75,25 +80,42 @@ func main() {
 }
 
 func newHTTPProxy(cfg *config.Config) http.Handler {
-	pick, match := route.Picker[cfg.Proxy.Strategy], route.Matcher[cfg.Proxy.Matcher]
+	strategyPick, match := route.Picker[cfg.Proxy.Strategy], route.Matcher[cfg.Proxy.Matcher]
 	log.Printf("[INFO] Using routing strategy %q", cfg.Proxy.Strategy)
 	log.Printf("[INFO] Using route matching %q", cfg.Proxy.Matcher)
 
-	return &proxy.HTTPProxy{
-		Config: cfg.Proxy,
-		Transport: &http.Transport{
+	// cache the local address set once so that the "localityfirst"
+	// strategy does not have to hit the network on every pick.
+	route.InitLocalAddrs()
+
+	// never hand out a target whose service is being drained, regardless
+	// of the configured strategy.
+	pick := func(targets route.Targets) *route.Target {
+		return strategyPick(route.FilterDraining(targets))
+	}
+
+	proxy.DefaultTransport = proxy.NewHostTransport(func() *http.Transport {
+		return &http.Transport{
 			ResponseHeaderTimeout: cfg.Proxy.ResponseHeaderTimeout,
 			MaxIdleConnsPerHost:   cfg.Proxy.MaxConn,
 			Dial: (&net.Dialer{
 				Timeout:   cfg.Proxy.DialTimeout,
 				KeepAlive: cfg.Proxy.KeepAliveTimeout,
 			}).Dial,
-		},
+		}
+	})
+
+	return &proxy.HTTPProxy{
+		Config:    cfg.Proxy,
+		Transport: proxy.DefaultTransport,
 		Lookup: func(r *http.Request) *route.Target {
-			t := route.GetTable().Lookup(r, r.Header.Get("trace"), pick, match)
+			tagPick := route.WrapPicker(r, route.GetTagRouter(), pick)
+			t := route.GetTable().Lookup(r, r.Header.Get("trace"), tagPick, match)
 			if t == nil {
 				log.Print("[WARN] No route for ", r.Host, r.URL)
+				return nil
 			}
+			route.RecordHost(t)
 			return t
 		},
 		ShuttingDown: exit.ShuttingDown,
@@ -116,6 +138,88 @@ func newTCPSNIProxy(cfg *config.Config) *proxy.TCPSNIProxy {
 	}
 }
 
+// startListeners starts one goroutine per cfg.Listen entry, dispatching
+// plain and TLS HTTP traffic to httpHandler and TCP+SNI traffic to
+// tcpHandler. Entries with Proto "https" get a *tls.Config built from
+// their CertSource via the cert package, so the listener's certificate
+// (and, for mTLS, its client CA bundle and CN/SAN allow-list) can be
+// hot-reloaded without restarting the listener. "tcp+sni" listeners never
+// terminate TLS at fabio -- the whole point of the TCP+SNI proxy is to
+// read the SNI hostname out of the still-encrypted ClientHello and
+// forward the raw bytes to a backend that terminates TLS itself.
+func startListeners(listen []config.Listen, wait time.Duration, httpHandler http.Handler, tcpHandler *proxy.TCPSNIProxy) {
+	for _, l := range listen {
+		l := l
+		go func() {
+			if err := startListener(l, wait, httpHandler, tcpHandler); err != nil {
+				exit.Fatal("[FATAL] ", err)
+			}
+		}()
+	}
+}
+
+// newCertManager builds the cert.Manager for an "https" listener from its
+// CertSource spec and mTLS options.
+func newCertManager(l config.Listen) (*cert.Manager, error) {
+	src, err := cert.NewSourceFromSpec(l.CertSource)
+	if err != nil {
+		return nil, err
+	}
+	mgr, err := cert.NewManager(src)
+	if err != nil {
+		return nil, err
+	}
+	if l.ClientAuth {
+		mgr.ClientAuth = tls.RequireAndVerifyClientCert
+		mgr.AllowedCN = l.ClientAuthAllowedCN
+		mgr.AllowedSAN = l.ClientAuthAllowedSAN
+	}
+	return mgr, nil
+}
+
+func startListener(l config.Listen, wait time.Duration, httpHandler http.Handler, tcpHandler *proxy.TCPSNIProxy) error {
+	ln, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %s", l.Addr, err)
+	}
+
+	switch l.Proto {
+	case "https":
+		if l.CertSource == "" {
+			return fmt.Errorf("listen %s: proto %q requires a cert source", l.Addr, l.Proto)
+		}
+		mgr, err := newCertManager(l)
+		if err != nil {
+			return fmt.Errorf("listen %s: %s", l.Addr, err)
+		}
+		ln = tls.NewListener(ln, mgr.TLSConfig())
+
+	case "tcp+sni":
+		// Unlike "https", tcp+sni must never terminate TLS at fabio: the
+		// proxy reads the SNI hostname out of the still-encrypted
+		// ClientHello and forwards the raw bytes on to the backend,
+		// which is the one that terminates TLS. A CertSource makes no
+		// sense here, so it's rejected rather than silently ignored.
+		if l.CertSource != "" {
+			return fmt.Errorf("listen %s: proto %q does not support a cert source, TLS is terminated by the backend", l.Addr, l.Proto)
+		}
+	}
+
+	log.Printf("[INFO] %s proxy listening on %s", l.Proto, l.Addr)
+
+	if l.Proto == "tcp+sni" {
+		return tcpHandler.Serve(ln)
+	}
+
+	srv := &http.Server{Handler: httpHandler}
+	exit.Listen(func(os.Signal) {
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return srv.Serve(ln)
+}
+
 func startAdmin(cfg *config.Config) {
 	log.Printf("[INFO] Admin server listening on %q", cfg.UI.Addr)
 	go func() {
@@ -126,6 +230,7 @@ func startAdmin(cfg *config.Config) {
 			Commands: route.Commands,
 			Cfg:      cfg,
 		}
+		srv.RegisterAPI(http.DefaultServeMux)
 		if err := srv.ListenAndServe(cfg.UI.Addr); err != nil {
 			exit.Fatal("[FATAL] ui: ", err)
 		}
@@ -175,6 +280,8 @@ func initBackend(cfg *config.Config) {
 			registry.Default, err = static.NewBackend(cfg.Registry.Static.Routes)
 		case "consul":
 			registry.Default, err = consul.NewBackend(&cfg.Registry.Consul)
+		case "nats-jetstream":
+			registry.Default, err = natsjskv.NewBackend(&cfg.Registry.NatsJSKV)
 		default:
 			exit.Fatal("[FATAL] Unknown registry backend ", cfg.Registry.Backend)
 		}
@@ -226,11 +333,40 @@ func watchBackend(cfg *config.Config) {
 			continue
 		}
 		route.SetTable(t)
+		route.SetTagRouter(route.ParseTagRouterConfig(next))
 		logRoutes(last, next, cfg.Proxy.LogRoutes)
+		drainRemovedServices(last, next, cfg.Proxy.ShutdownWait)
 		last = next
 	}
 }
 
+// removedServiceRE extracts the service name from a "route add <service>
+// ..." line of the config language so that drainRemovedServices can tell
+// which services disappeared between two route table generations.
+var removedServiceRE = regexp.MustCompile(`(?m)^route add (\S+)`)
+
+// drainRemovedServices starts a graceful drain, see proxy.DrainService,
+// for every service present in last but no longer present in next,
+// instead of letting route.SetTable tear down their connections abruptly.
+func drainRemovedServices(last, next string, wait time.Duration) {
+	if proxy.DefaultTransport == nil {
+		return
+	}
+
+	still := map[string]bool{}
+	for _, m := range removedServiceRE.FindAllStringSubmatch(next, -1) {
+		still[m[1]] = true
+	}
+
+	for _, m := range removedServiceRE.FindAllStringSubmatch(last, -1) {
+		service := m[1]
+		if !still[service] {
+			log.Printf("[INFO] Draining removed service %q", service)
+			proxy.DrainService(proxy.DefaultTransport, service, wait)
+		}
+	}
+}
+
 func logRoutes(last, next, format string) {
 	fmtDiff := func(diffs []dmp.Diff) string {
 		var b bytes.Buffer
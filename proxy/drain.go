@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"log"
+	"time"
+
+	"github.com/eBay/fabio/route"
+)
+
+// DrainService marks service as draining -- newHTTPProxy's picker (see
+// route.FilterDraining) immediately stops handing out its targets for
+// new HTTP requests -- then waits up to
+// wait for the service's in-flight requests (tracked by tr, the
+// HostTransport every request is actually dispatched through) to finish
+// before closing the idle connections tr holds open to every host the
+// service has ever resolved to. It is called from watchBackend when a
+// service disappears from the registry and from
+// admin.Server.DrainHandler for an operator-issued `drain <service>`.
+func DrainService(tr *HostTransport, service string, wait time.Duration) {
+	route.Drain(service)
+
+	go func() {
+		deadline := time.Now().Add(wait)
+		for time.Now().Before(deadline) {
+			if remaining(tr, service) == 0 {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if n := remaining(tr, service); n > 0 {
+			log.Printf("[WARN] proxy: draining %q with %d requests still in flight after %s", service, n, wait)
+		}
+
+		hosts := route.HostsForService(service)
+		for _, host := range hosts {
+			tr.CloseHost(host)
+		}
+		log.Printf("[INFO] proxy: drained %q, closed idle connections to %v", service, hosts)
+	}()
+}
+
+func remaining(tr *HostTransport, service string) int64 {
+	var n int64
+	for _, host := range route.HostsForService(service) {
+		n += tr.InFlight(host)
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/eBay/fabio/metrics"
+)
+
+// HostTransport is an http.RoundTripper that keeps one *http.Transport
+// per destination host. A single shared http.Transport only exposes
+// CloseIdleConnections for *all* hosts at once, which would sever every
+// keep-alive connection fabio holds just to retire one drained backend.
+// Splitting the pool per host lets DrainService close exactly the
+// connections that belong to the backend being retired.
+//
+// RoundTrip is also the one place every proxied request actually passes
+// through, so it is where the per-host in-flight counter DrainService
+// waits on is maintained, and where that counter is exported to
+// metrics.DefaultRegistry as "target.inflight.<host>".
+type HostTransport struct {
+	// newTransport builds the *http.Transport used the first time a
+	// host is seen. It is the same dial/timeout configuration fabio has
+	// always used for its single shared transport.
+	newTransport func() *http.Transport
+
+	mu       sync.RWMutex
+	byHost   map[string]*http.Transport
+	inflight map[string]*int64
+}
+
+// DefaultTransport is the HostTransport newHTTPProxy installs on the
+// proxy. watchBackend uses it to drain individual backends without
+// reaching into proxy.HTTPProxy's internals.
+var DefaultTransport *HostTransport
+
+// NewHostTransport creates a HostTransport whose per-host transports are
+// all built by newTransport.
+func NewHostTransport(newTransport func() *http.Transport) *HostTransport {
+	return &HostTransport{
+		newTransport: newTransport,
+		byHost:       map[string]*http.Transport{},
+		inflight:     map[string]*int64{},
+	}
+}
+
+func (h *HostTransport) transportFor(host string) *http.Transport {
+	h.mu.RLock()
+	t, ok := h.byHost[host]
+	h.mu.RUnlock()
+	if ok {
+		return t
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t, ok := h.byHost[host]; ok {
+		return t
+	}
+	t = h.newTransport()
+	h.byHost[host] = t
+	return t
+}
+
+// RoundTrip implements http.RoundTripper by delegating to the transport
+// dedicated to req.URL.Host, tracking the request for the duration of
+// the round trip in the host's in-flight counter.
+func (h *HostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	counter := h.counterFor(host)
+
+	n := atomic.AddInt64(counter, 1)
+	metrics.DefaultRegistry.GetGauge("target.inflight." + host).Update(n)
+	defer func() {
+		n := atomic.AddInt64(counter, -1)
+		metrics.DefaultRegistry.GetGauge("target.inflight." + host).Update(n)
+	}()
+
+	return h.transportFor(host).RoundTrip(req)
+}
+
+func (h *HostTransport) counterFor(host string) *int64 {
+	h.mu.RLock()
+	c, ok := h.inflight[host]
+	h.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.inflight[host]; ok {
+		return c
+	}
+	c = new(int64)
+	h.inflight[host] = c
+	return c
+}
+
+// InFlight returns the number of requests currently in flight to host.
+func (h *HostTransport) InFlight(host string) int64 {
+	h.mu.RLock()
+	c, ok := h.inflight[host]
+	h.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(c)
+}
+
+// CloseHost closes the idle connections fabio holds open to host and
+// discards its dedicated transport so that a future request to the same
+// host starts from a clean pool.
+func (h *HostTransport) CloseHost(host string) {
+	h.mu.Lock()
+	t, ok := h.byHost[host]
+	delete(h.byHost, host)
+	delete(h.inflight, host)
+	h.mu.Unlock()
+
+	if ok {
+		t.CloseIdleConnections()
+	}
+}
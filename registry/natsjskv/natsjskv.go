@@ -0,0 +1,249 @@
+// Package natsjskv provides a registry.Backend implementation backed by a
+// NATS JetStream key/value bucket.
+//
+// Each fabio instance registers its routes as a single KV entry keyed by
+// "service.<name>.<id>", name and id base64 encoded. TTL is delegated to JetStream via the bucket's
+// MaxAge setting so that a crashed instance disappears from the routing
+// table without requiring an explicit deregister. WatchServices and
+// WatchManual are driven by the bucket Watcher so route table rebuilds
+// only happen on real membership changes instead of on a polling
+// interval.
+package natsjskv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eBay/fabio/config"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	servicePrefix = "service"
+	manualKey     = "manual.config"
+
+	// refreshFraction of cfg.TTL sets the re-Put interval, leaving
+	// comfortable headroom so a slow tick or a brief NATS hiccup doesn't
+	// let the bucket's MaxAge evict a still-healthy instance.
+	refreshFraction = 3
+)
+
+// be is the registry.Backend implementation for NATS JetStream KV.
+type be struct {
+	cfg *config.NatsJSKV
+	nc  *nats.Conn
+	js  nats.JetStreamContext
+	kv  nats.KeyValue
+
+	id string
+
+	svc chan string
+	man chan string
+
+	stop chan struct{}
+
+	mu         sync.Mutex
+	registered bool
+}
+
+// NewBackend creates a new NATS JetStream KV backend.
+//
+// It connects to the NATS cluster and creates (or binds to an existing)
+// JetStream KV bucket. The watch goroutines that feed WatchServices and
+// WatchManual are started by Register.
+func NewBackend(cfg *config.NatsJSKV) (*be, error) {
+	nc, err := nats.Connect(cfg.Addr, nats.Name("fabio"))
+	if err != nil {
+		return nil, fmt.Errorf("natsjskv: connect: %s", err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("natsjskv: jetstream: %s", err)
+	}
+
+	kv, err := js.KeyValue(cfg.Bucket)
+	if err != nil {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:  cfg.Bucket,
+			TTL:     cfg.TTL,
+			History: 1,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("natsjskv: create bucket %q: %s", cfg.Bucket, err)
+		}
+	}
+
+	b := &be{
+		cfg: cfg,
+		nc:  nc,
+		js:  js,
+		kv:  kv,
+		id:   cfg.ServiceAddr,
+		svc:  make(chan string),
+		man:  make(chan string),
+		stop: make(chan struct{}),
+	}
+	return b, nil
+}
+
+// Register registers this fabio instance as a KV entry. The entry's value
+// is the config language fragment for this instance's routes and is
+// refreshed periodically so that the bucket's MaxAge based TTL never
+// expires while fabio is healthy.
+func (b *be) Register() error {
+	key := serviceKey(b.cfg.ServiceName, b.id)
+	if _, err := b.kv.PutString(key, b.cfg.Routes); err != nil {
+		return fmt.Errorf("natsjskv: register: %s", err)
+	}
+
+	b.mu.Lock()
+	b.registered = true
+	b.mu.Unlock()
+
+	go b.watchServices()
+	go b.watchManual()
+	go b.refresh(key)
+
+	log.Printf("[INFO] natsjskv: registered %s", key)
+	return nil
+}
+
+// refresh re-Puts key on an interval well inside cfg.TTL so that the
+// bucket's MaxAge based TTL evicts crashed instances -- which stop
+// refreshing -- without also evicting instances that are perfectly
+// healthy but simply registered once, a long time ago.
+func (b *be) refresh(key string) {
+	t := time.NewTicker(b.cfg.TTL / refreshFraction)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if _, err := b.kv.PutString(key, b.cfg.Routes); err != nil {
+				log.Printf("[WARN] natsjskv: refresh %s: %s", key, err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Deregister removes this fabio instance's KV entry.
+func (b *be) Deregister() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.registered {
+		return nil
+	}
+	b.registered = false
+	close(b.stop)
+	key := serviceKey(b.cfg.ServiceName, b.id)
+	if err := b.kv.Delete(key); err != nil {
+		return fmt.Errorf("natsjskv: deregister: %s", err)
+	}
+	return nil
+}
+
+// WatchServices returns the channel that receives the config language
+// representation of the service table whenever the set of registered
+// service instances changes.
+func (b *be) WatchServices() chan string {
+	return b.svc
+}
+
+// WatchManual returns the channel that receives the config language
+// representation of the manual overrides whenever they change.
+func (b *be) WatchManual() chan string {
+	return b.man
+}
+
+// watchServices watches every key under the "service" prefix, regardless
+// of how many name/id segments it has, and pushes the merged config
+// language representation of all live registrations to svc whenever the
+// set changes. All live endpoints are returned on every lookup so that
+// route.Picker balances load across replicas instead of traffic pinning
+// to whichever instance happened to register first.
+func (b *be) watchServices() {
+	// "service.>" is the multi-level wildcard: it matches every key
+	// that has "service" as its first token no matter how many more
+	// tokens follow, which "service.*" (single level) would not since
+	// a key is "service.<name>.<id>", three tokens deep.
+	w, err := b.kv.Watch(servicePrefix + ".>")
+	if err != nil {
+		log.Printf("[WARN] natsjskv: watch %q: %s", servicePrefix+".>", err)
+		return
+	}
+	defer w.Stop()
+
+	for entry := range w.Updates() {
+		if entry == nil {
+			// initial sync complete
+			continue
+		}
+		cfg, err := b.snapshot()
+		if err != nil {
+			log.Printf("[WARN] natsjskv: snapshot: %s", err)
+			continue
+		}
+		b.svc <- cfg
+	}
+}
+
+// watchManual watches the single manual overrides key and pushes its
+// value to man whenever it changes.
+func (b *be) watchManual() {
+	w, err := b.kv.Watch(manualKey)
+	if err != nil {
+		log.Printf("[WARN] natsjskv: watch %q: %s", manualKey, err)
+		return
+	}
+	defer w.Stop()
+
+	for entry := range w.Updates() {
+		if entry == nil {
+			continue
+		}
+		b.man <- string(entry.Value())
+	}
+}
+
+// snapshot builds the config language representation of every live
+// service registration in the bucket.
+func (b *be) snapshot() (string, error) {
+	keys, err := b.kv.Keys()
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, k := range keys {
+		if !strings.HasPrefix(k, servicePrefix+".") {
+			continue
+		}
+		entry, err := b.kv.Get(k)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, string(entry.Value()))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// serviceKey builds a JetStream safe key for a service instance. JetStream
+// keys are subject-like and use "." as their token separator, so both
+// name and id are base64 (URL safe, no padding) encoded before being
+// joined with dots -- a raw name or id containing a "." or "/" would
+// otherwise either be rejected or be silently folded into the wildcard
+// hierarchy used by watchServices.
+func serviceKey(name, id string) string {
+	return servicePrefix + "." + encodeKey(name) + "." + encodeKey(id)
+}
+
+func encodeKey(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
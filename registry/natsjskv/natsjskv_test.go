@@ -0,0 +1,51 @@
+package natsjskv
+
+import "testing"
+
+func TestEncodeKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"web", "d2Vi"},
+		{"127.0.0.1:9090", "MTI3LjAuMC4xOjkwOTA"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := encodeKey(tt.in); got != tt.want {
+			t.Errorf("encodeKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestServiceKey(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{"web", "127.0.0.1:9090", "service.d2Vi.MTI3LjAuMC4xOjkwOTA"},
+		{"a.b/c", "d", "service." + encodeKey("a.b/c") + "." + encodeKey("d")},
+	}
+
+	for _, tt := range tests {
+		got := serviceKey(tt.name, tt.id)
+		if got != tt.want {
+			t.Errorf("serviceKey(%q, %q) = %q, want %q", tt.name, tt.id, got, tt.want)
+		}
+		// The key must round-trip through the "." token separator
+		// cleanly: exactly three tokens, none of which themselves
+		// contain a "." or "/" that could be misread as a subject
+		// boundary by watchServices' wildcard match.
+		tokens := 1
+		for _, c := range got[len(servicePrefix)+1:] {
+			if c == '.' {
+				tokens++
+			}
+		}
+		if tokens != 2 {
+			t.Errorf("serviceKey(%q, %q) = %q, want exactly 2 tokens after the prefix, got %d", tt.name, tt.id, got, tokens)
+		}
+	}
+}
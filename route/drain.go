@@ -0,0 +1,82 @@
+package route
+
+import (
+	"sync"
+)
+
+// serviceHosts remembers every backend host a service has ever resolved
+// to, so that once a service is drained the proxy's transport knows which
+// hosts' idle connections to close without having to wait for a fresh
+// target to reveal them. It is populated by RecordHost, which
+// newHTTPProxy's Lookup calls for every target it hands out.
+var serviceHosts sync.Map // string -> *sync.Map (host -> struct{})
+
+// drained holds the set of services an operator asked to drain via the
+// `drain <service>` admin command (admin.Server.DrainHandler), or that
+// watchBackend marked because the service disappeared from the registry.
+var drained sync.Map // string -> struct{}
+
+// RecordHost records that service currently resolves to (at least) the
+// host t.URL.Host points at. It does not count in-flight requests --
+// proxy.HostTransport does that at the point where a request is actually
+// dispatched -- it only remembers the mapping so DrainService knows which
+// hosts to close once the service is drained.
+func RecordHost(t *Target) {
+	hosts, _ := serviceHosts.LoadOrStore(t.Service, &sync.Map{})
+	hosts.(*sync.Map).Store(t.URL.Host, struct{}{})
+}
+
+// HostsForService returns every backend host service has ever resolved
+// to, in no particular order.
+func HostsForService(service string) []string {
+	v, ok := serviceHosts.Load(service)
+	if !ok {
+		return nil
+	}
+	var hosts []string
+	v.(*sync.Map).Range(func(k, _ interface{}) bool {
+		hosts = append(hosts, k.(string))
+		return true
+	})
+	return hosts
+}
+
+// Drain marks service as draining: newHTTPProxy's picker, which runs
+// targets through FilterDraining, stops returning its targets for new
+// HTTP lookups (the TCP+SNI proxy's lookup does not filter them), but
+// requests already in flight are left
+// alone. The caller is responsible for waiting out cfg.Proxy.ShutdownWait
+// and closing the backend's connections once it is actually idle -- see
+// proxy.DrainService.
+func Drain(service string) {
+	drained.Store(service, struct{}{})
+}
+
+// Undrain reverses Drain.
+func Undrain(service string) {
+	drained.Delete(service)
+}
+
+// IsDraining reports whether service has been marked for drain.
+func IsDraining(service string) bool {
+	_, ok := drained.Load(service)
+	return ok
+}
+
+// FilterDraining removes targets belonging to a draining service from a
+// candidate set before it reaches route.Picker, the same way
+// TagRouter.Filter and isLocal narrow the candidate set for the
+// localityfirst and tag-router features.
+func FilterDraining(targets Targets) Targets {
+	var out Targets
+	for _, t := range targets {
+		if !IsDraining(t.Service) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func init() {
+	Commands += "\n\ndrain <service>\n    Stop sending new requests to <service> and keep its in-flight\n    requests alive for cfg.Proxy.ShutdownWait before closing its idle\n    connections. Triggered via POST /api/drain on the admin server.\n    Use `undrain <service>` to reverse.\n\nundrain <service>\n    Reverse a previous `drain <service>`.\n"
+}
@@ -0,0 +1,117 @@
+package route
+
+import (
+	"log"
+	"net"
+	"sync"
+)
+
+func init() {
+	Picker["localityfirst"] = newLocalityFirstPicker("rr")
+	Picker["localityfirst-rnd"] = newLocalityFirstPicker("rnd")
+}
+
+var (
+	localAddrMu sync.RWMutex
+	localAddrs  = map[string]bool{}
+	localNets   []*net.IPNet
+)
+
+// InitLocalAddrs caches the IP addresses and networks of this fabio
+// instance's network interfaces. It is called once at startup, before the
+// proxy starts serving, so that the "localityfirst" strategy can tell a
+// colocated target apart from a remote one without touching the network
+// on every request.
+func InitLocalAddrs() {
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Printf("[WARN] route: cannot determine local addresses: %s", err)
+		return
+	}
+
+	addrs := map[string]bool{}
+	var nets []*net.IPNet
+	for _, a := range ifaceAddrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addrs[ipnet.IP.String()] = true
+		nets = append(nets, ipnet)
+	}
+
+	localAddrMu.Lock()
+	localAddrs, localNets = addrs, nets
+	localAddrMu.Unlock()
+}
+
+// LocalAddrs returns the cached local addresses and networks as strings
+// for display in the admin UI, so that operators can see why the
+// "localityfirst" strategy picked a given target.
+func LocalAddrs() []string {
+	localAddrMu.RLock()
+	defer localAddrMu.RUnlock()
+
+	out := make([]string, 0, len(localAddrs)+len(localNets))
+	for ip := range localAddrs {
+		out = append(out, ip)
+	}
+	for _, n := range localNets {
+		out = append(out, n.String())
+	}
+	return out
+}
+
+// isLocal reports whether target's host is one of this instance's own
+// addresses or falls within one of its local networks (e.g. the same
+// /24 for IPv4 or /64 for IPv6).
+func isLocal(target *Target) bool {
+	host, _, err := net.SplitHostPort(target.URL.Host)
+	if err != nil {
+		host = target.URL.Host
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	localAddrMu.RLock()
+	defer localAddrMu.RUnlock()
+
+	if localAddrs[ip.String()] {
+		return true
+	}
+	for _, n := range localNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newLocalityFirstPicker returns a Picker that prefers targets colocated
+// with this fabio instance, falling back to the named strategy ("rr" or
+// "rnd") among the remaining targets when no local target exists or none
+// of the local targets are healthy. This keeps colocated traffic
+// colocated and avoids an extra network hop in deployments where fabio
+// and its backends share a host or rack, while still letting an operator
+// choose cfg.Proxy.Strategy = "localityfirst" or "localityfirst-rnd" for
+// the two fallback behaviors instead of fixing one in code.
+func newLocalityFirstPicker(fallbackStrategy string) func(Targets) *Target {
+	return func(targets Targets) *Target {
+		fallback := Picker[fallbackStrategy]
+
+		var local Targets
+		for _, t := range targets {
+			if isLocal(t) {
+				local = append(local, t)
+			}
+		}
+		if len(local) > 0 {
+			if t := fallback(local); t != nil {
+				return t
+			}
+		}
+		return fallback(targets)
+	}
+}
@@ -0,0 +1,43 @@
+package route
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestIsLocal(t *testing.T) {
+	localAddrMu.Lock()
+	localAddrs = map[string]bool{"10.0.0.5": true}
+	_, ipnet, _ := net.ParseCIDR("192.168.1.0/24")
+	localNets = []*net.IPNet{ipnet}
+	localAddrMu.Unlock()
+	defer func() {
+		localAddrMu.Lock()
+		localAddrs = map[string]bool{}
+		localNets = nil
+		localAddrMu.Unlock()
+	}()
+
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{"exact address match", "10.0.0.5:8080", true},
+		{"exact address match, no port", "10.0.0.5", true},
+		{"address within local network", "192.168.1.42:80", true},
+		{"address outside local network", "192.168.2.42:80", false},
+		{"unrelated address", "8.8.8.8:53", false},
+		{"unparsable host", "not-an-ip:80", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &Target{URL: &url.URL{Host: tt.host}}
+			if got := isLocal(target); got != tt.want {
+				t.Errorf("isLocal(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
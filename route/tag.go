@@ -0,0 +1,201 @@
+package route
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// TagRouter resolves the tag, if any, that an incoming request is asking
+// for and restricts route.Picker to targets advertising that tag.
+//
+// This is distinct from fabio's static "-tags" startup flag, which scopes
+// the whole instance to a fixed set of tags at boot. TagRouter makes the
+// selection per request, so a single fabio instance can serve canary and
+// stable traffic side by side, shifting the split by editing the "tag="
+// label on routes in consul KV -- no redeploy required. Target.Tags is
+// parsed from that same "tag=" route option, so no changes are needed to
+// how routes are registered.
+//
+// A TagRouter's own Header/Cookie/JWTClaim fields are themselves part of
+// the route table config text (a "tagrouter ..." directive) and are
+// therefore hot-reloaded by watchBackend's existing diff mechanism the
+// same way routes are -- see ParseTagRouterConfig and SetTagRouter.
+type TagRouter struct {
+	// Header is the request header carrying the requested tag.
+	Header string
+
+	// Cookie is an optional cookie name consulted when Header is empty
+	// or not present on the request.
+	Cookie string
+
+	// JWTClaim, when set, is consulted after Header and Cookie: the
+	// bearer token in the Authorization header is decoded (without
+	// signature verification -- fabio is not the token's audience, it
+	// only reads a routing hint out of it) and the named claim is used
+	// as the requested tag.
+	JWTClaim string
+}
+
+// DefaultTagRouter is the TagRouter used by newHTTPProxy's Lookup until
+// the first "tagrouter ..." directive is seen in the route table config.
+var DefaultTagRouter = &TagRouter{Header: "X-Fabio-Tag"}
+
+// currentTagRouter holds the *TagRouter currently in effect. It is
+// updated by SetTagRouter and read by GetTagRouter.
+var currentTagRouter atomic.Value
+
+func init() {
+	currentTagRouter.Store(DefaultTagRouter)
+}
+
+// GetTagRouter returns the TagRouter currently in effect.
+func GetTagRouter() *TagRouter {
+	return currentTagRouter.Load().(*TagRouter)
+}
+
+// SetTagRouter installs tr as the TagRouter used by newHTTPProxy's
+// Lookup. watchBackend calls this with the result of
+// ParseTagRouterConfig after every route table rebuild.
+func SetTagRouter(tr *TagRouter) {
+	currentTagRouter.Store(tr)
+}
+
+// ParseTagRouterConfig scans the config language text watchBackend
+// builds from the registry for a line of the form
+//
+//	tagrouter header=X-Fabio-Tag cookie=canary jwtclaim=tag
+//
+// and returns the TagRouter it describes, or DefaultTagRouter if no such
+// line is present. Only the last "tagrouter" line wins, consistent with
+// how the manual config already overrides the service config in that
+// same text.
+func ParseTagRouterConfig(text string) *TagRouter {
+	tr := *DefaultTagRouter // copy so callers can't mutate the default
+	found := false
+
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "tagrouter" {
+			continue
+		}
+		found = true
+		tr = TagRouter{}
+		for _, opt := range fields[1:] {
+			k, v, ok := strings.Cut(opt, "=")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "header":
+				tr.Header = v
+			case "cookie":
+				tr.Cookie = v
+			case "jwtclaim":
+				tr.JWTClaim = v
+			}
+		}
+	}
+
+	if !found {
+		return DefaultTagRouter
+	}
+	return &tr
+}
+
+// RequestTag returns the tag requested by r, or "" if r does not ask for
+// one, in which case only untagged targets are eligible.
+func (tr *TagRouter) RequestTag(r *http.Request) string {
+	if tr == nil {
+		return ""
+	}
+	if tr.Header != "" {
+		if v := r.Header.Get(tr.Header); v != "" {
+			return v
+		}
+	}
+	if tr.Cookie != "" {
+		if c, err := r.Cookie(tr.Cookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	if tr.JWTClaim != "" {
+		if v := jwtClaim(r, tr.JWTClaim); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// jwtClaim extracts claim from the unverified payload of the bearer
+// token on r's Authorization header, returning "" if there is no bearer
+// token, it isn't a well-formed JWT, or the claim isn't present/a string.
+func jwtClaim(r *http.Request, claim string) string {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+
+	parts := strings.Split(strings.TrimPrefix(auth, prefix), ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+
+	v, _ := claims[claim].(string)
+	return v
+}
+
+// Filter restricts targets to those matching tag. A request without a
+// tag only sees untagged targets; a request with a tag only sees targets
+// carrying that tag. Unlike a plain routing strategy, an empty result is
+// valid and expected here -- e.g. a canary tag with no live instances
+// left -- and must NOT fall back to the full target set, since that
+// would let untagged traffic leak onto tagged backends (and vice versa).
+func (tr *TagRouter) Filter(targets Targets, tag string) Targets {
+	var out Targets
+	for _, t := range targets {
+		if tag == "" {
+			if len(t.Tags) == 0 {
+				out = append(out, t)
+			}
+			continue
+		}
+		if hasTag(t.Tags, tag) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// WrapPicker returns a Picker that filters the candidate targets for r
+// through tr before delegating to pick. It is built once per request by
+// newHTTPProxy's Lookup closure so that Table.Lookup does not need to
+// know about tags at all.
+func WrapPicker(r *http.Request, tr *TagRouter, pick func(Targets) *Target) func(Targets) *Target {
+	tag := tr.RequestTag(r)
+	return func(targets Targets) *Target {
+		return pick(tr.Filter(targets, tag))
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package route
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTagRouterConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want TagRouter
+	}{
+		{
+			name: "no directive falls back to default",
+			text: "route add svc / http://1.2.3.4:80\n",
+			want: *DefaultTagRouter,
+		},
+		{
+			name: "full directive",
+			text: "tagrouter header=X-Canary cookie=canary jwtclaim=tag\n",
+			want: TagRouter{Header: "X-Canary", Cookie: "canary", JWTClaim: "tag"},
+		},
+		{
+			name: "last directive wins",
+			text: "tagrouter header=X-First\ntagrouter header=X-Second\n",
+			want: TagRouter{Header: "X-Second"},
+		},
+		{
+			name: "unknown options are ignored",
+			text: "tagrouter header=X-Tag bogus=nope\n",
+			want: TagRouter{Header: "X-Tag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseTagRouterConfig(tt.text)
+			if *got != tt.want {
+				t.Errorf("ParseTagRouterConfig(%q) = %+v, want %+v", tt.text, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTClaim(t *testing.T) {
+	payload := func(claims map[string]interface{}) string {
+		b, err := json.Marshal(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name  string
+		auth  string
+		claim string
+		want  string
+	}{
+		{"matching claim", "Bearer header." + payload(map[string]interface{}{"tag": "canary"}) + ".sig", "tag", "canary"},
+		{"missing claim", "Bearer header." + payload(map[string]interface{}{"other": "x"}) + ".sig", "tag", ""},
+		{"no bearer prefix", "Basic abc", "tag", ""},
+		{"malformed token", "Bearer not-a-jwt", "tag", ""},
+		{"no authorization header", "", "tag", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			if got := jwtClaim(r, tt.claim); got != tt.want {
+				t.Errorf("jwtClaim() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagRouterFilter(t *testing.T) {
+	targets := Targets{
+		{Tags: nil},
+		{Tags: []string{"canary"}},
+		{Tags: []string{"stable"}},
+	}
+	tr := &TagRouter{}
+
+	t.Run("empty tag matches only untagged targets", func(t *testing.T) {
+		got := tr.Filter(targets, "")
+		if len(got) != 1 || got[0] != targets[0] {
+			t.Errorf("Filter(targets, \"\") = %v, want only the untagged target", got)
+		}
+	})
+
+	t.Run("set tag matches only targets carrying it", func(t *testing.T) {
+		got := tr.Filter(targets, "canary")
+		if len(got) != 1 || got[0] != targets[1] {
+			t.Errorf("Filter(targets, \"canary\") = %v, want only the canary target", got)
+		}
+	})
+
+	t.Run("no match returns empty, not the full set", func(t *testing.T) {
+		got := tr.Filter(targets, "nonexistent")
+		if len(got) != 0 {
+			t.Errorf("Filter(targets, \"nonexistent\") = %v, want empty", got)
+		}
+	})
+}